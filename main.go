@@ -1,35 +1,58 @@
 package main
 
 import (
+	"bytes"
 	"embed"
 	"fmt"
+	"html"
 	"io/fs"
 	"log"
 	"net/http"
+	"net/url"
+	"os"
+	"path"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
+	"time"
 )
 
 //go:embed files
 var embeddedFiles embed.FS
 
 func main() {
-	filesDir := embeddedFiles
+	// The embedded copy is the fallback; a live "./files" directory
+	// on disk, if present, overlays it, so operators can drop in
+	// replacements for embedded assets without rebuilding the binary.
+	embeddedRoot, err := fs.Sub(embeddedFiles, "files")
+	if err != nil {
+		log.Fatal(err)
+	}
+	filesDir := NewUnionFS(os.DirFS("./files"), embeddedRoot)
 
-	// Make sure that directory listings
-	// won't happen by making a directory
-	// listable only via an index.html file:
-	filteredDir := FilteringFS{
-		fs: filesDir,
+	// Make sure that directory listings only happen where we've
+	// explicitly opted in; everywhere else a directory still needs
+	// an index.html file or go home! Dot files and backups are
+	// hidden everywhere, across every layer of the union.
+	filteredDir := NewFilteringFS(filesDir, Options{
+		HideDotFiles:     true,
+		RequireIndexHTML: true,
+		Exclude: []*regexp.Regexp{
+			regexp.MustCompile(`~$`),
+		},
+	})
+	filteredDir.dirOpts = DirOpts{
+		Listing: map[string]bool{
+			"assets": true,
+		},
 	}
 
-	// Use a bit of middleware to filter out
-	// dot files (see below)
 	handler := wrappedFileServer(filteredDir)
 	http.Handle("/", handler)
 
 	log.Println("Serving static files at :5000")
-	err := http.ListenAndServe(":5000", handler)
+	err = http.ListenAndServe(":5000", handler)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -58,38 +81,179 @@ func listFiles(indent string, dir fs.FS, path string) error {
 	return nil
 }
 
-// Wrap file server and block dot files from appearing
-func wrappedFileServer(root fs.FS) http.Handler {
+// Wrap file server; the exclusion and dot-file policy now lives in
+// FilteringFS itself, so any fs.FS caller gets the same treatment,
+// not just HTTP requests.
+func wrappedFileServer(root FilteringFS) http.Handler {
 	handler := func(w http.ResponseWriter, r *http.Request) {
-		url := r.URL.Path
-		// strip off the initial / if it's there
-		if len(url) > 0 && url[:1] == "/" {
-			url = url[1:]
-		}
-		path := strings.Split(url, "/")
-
-		for _, stem := range path {
-			// If it's a dot file, make it unseen
-			if len(stem) > 0 && stem[:1] == "." {
-				http.NotFound(w, r)
-				return
-			}
+		if serveListing(w, r, root) {
+			return
 		}
+
 		// We're using fs.FS and not http.FileSystem, so convert
 		// with http.FS:
 		fileServer := http.StripPrefix("/", http.FileServer(http.FS(root)))
-		// and dispatch our approved files to that handler
+		// and dispatch to that handler; FilteringFS.Open is what
+		// decides what's actually visible.
 		fileServer.ServeHTTP(w, r)
 	}
 
 	return http.HandlerFunc(handler)
 }
 
+// serveListing renders name's generated directory listing directly,
+// for the one request shape http.FileServer can't be trusted with: a
+// trailing-slash URL over a listing-eligible directory. listingFile
+// reports IsDir() == false so FileServer serves it like a plain file,
+// but that also trips FileServer's own redirect logic, which treats a
+// trailing slash on a non-directory as the wrong canonical form and
+// 301s it away to the slash-less path -- exactly the URL our own
+// listing hrefs point at. It reports whether it served the request.
+func serveListing(w http.ResponseWriter, r *http.Request, root FilteringFS) bool {
+	if (r.Method != http.MethodGet && r.Method != http.MethodHead) || !strings.HasSuffix(r.URL.Path, "/") {
+		return false
+	}
+
+	name := cleanFSPath(strings.TrimPrefix(r.URL.Path, "/"))
+	if name == "" {
+		name = "."
+	}
+	if !root.listingEligible(name) {
+		return false
+	}
+
+	body, err := renderListing(root, name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return true
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(body))
+	return true
+}
+
 // To block access to directory listings, wrap our file system
-// with another filesystem that blocks them.
+// with another filesystem that blocks them -- unless the path has
+// been opted into listings via DirOpts.
 
 type FilteringFS struct {
-	fs fs.FS
+	fs      fs.FS
+	options Options
+	dirOpts DirOpts
+}
+
+// Options configures a FilteringFS's exclusion and directory policy.
+type Options struct {
+	// Exclude hides any path matching one of these patterns, making
+	// it indistinguishable from a file that doesn't exist.
+	Exclude []*regexp.Regexp
+	// Include, if non-empty, hides any path that doesn't match one
+	// of these patterns.
+	Include []*regexp.Regexp
+	// HideDotFiles hides any path with a dot-prefixed path element.
+	HideDotFiles bool
+	// RequireIndexHTML, when true, blocks a bare directory listing
+	// unless either it has an index.html or the path has been
+	// opted into listings via DirOpts.
+	RequireIndexHTML bool
+}
+
+// NewFilteringFS wraps fsys with the filtering policy described by
+// opts. Directory listing exceptions are configured separately via
+// the returned FilteringFS's dirOpts field.
+func NewFilteringFS(fsys fs.FS, opts Options) FilteringFS {
+	return FilteringFS{
+		fs:      fsys,
+		options: opts,
+	}
+}
+
+// excluded reports whether name should be hidden from callers, per
+// wrapper.options. isDir must be true when name is itself a directory
+// (the FS root, or a directory being traversed, listed or opened) --
+// Include is a file-extension allowlist, so it only ever gates
+// regular files; applying it to directories too would block traversal
+// into any tree whose own name doesn't happen to match the pattern.
+func (wrapper FilteringFS) excluded(name string, isDir bool) bool {
+	opts := wrapper.options
+
+	if opts.HideDotFiles {
+		for _, stem := range strings.Split(name, "/") {
+			// "." on its own just means the FS root, not a hidden
+			// entry.
+			if stem != "." && len(stem) > 0 && stem[:1] == "." {
+				return true
+			}
+		}
+	}
+
+	for _, re := range opts.Exclude {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+
+	if !isDir && len(opts.Include) > 0 {
+		for _, re := range opts.Include {
+			if re.MatchString(name) {
+				return false
+			}
+		}
+		return true
+	}
+
+	return false
+}
+
+// DirOpts configures which paths are allowed to serve a generated
+// directory listing when no index.html is present. Listing maps a
+// path prefix to whether listings are permitted under that prefix;
+// the longest matching prefix wins, so a tree can be opened up and
+// have individual subtrees locked back down again.
+type DirOpts struct {
+	Listing map[string]bool
+}
+
+// ListingEnabled reports whether name may be listed, based on the
+// longest cleaned prefix in opts.Listing that contains name.
+func (opts DirOpts) ListingEnabled(name string) bool {
+	clean := cleanFSPath(name)
+
+	longest := -1
+	enabled := false
+	for prefix, allowed := range opts.Listing {
+		p := cleanFSPath(prefix)
+		if !pathHasPrefix(clean, p) {
+			continue
+		}
+		if len(p) > longest {
+			longest = len(p)
+			enabled = allowed
+		}
+	}
+
+	return enabled
+}
+
+// cleanFSPath normalizes an fs.FS-style path ("." for the root) down
+// to the empty string, so prefix comparisons don't need a special
+// case for the root.
+func cleanFSPath(name string) string {
+	clean := path.Clean(name)
+	if clean == "." {
+		return ""
+	}
+	return clean
+}
+
+// pathHasPrefix reports whether name is prefix, or lies under it.
+// An empty prefix matches everything.
+func pathHasPrefix(name, prefix string) bool {
+	if prefix == "" {
+		return true
+	}
+	return name == prefix || strings.HasPrefix(name, prefix+"/")
 }
 
 // And make the wrapper into an fs.FS by implementing its
@@ -98,6 +262,12 @@ type FilteringFS struct {
 // This is updated from Alex Edward's article from 2018:
 // @see https://www.alexedwards.net/blog/disable-http-fileserver-directory-listings
 func (wrapper FilteringFS) Open(name string) (fs.File, error) {
+	// We don't know yet whether name is a directory, so defer the
+	// Include check (isDir=true skips it) until Stat tells us.
+	if wrapper.excluded(name, true) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
 	f, err := wrapper.fs.Open(name)
 	if err != nil {
 		return nil, err
@@ -108,18 +278,329 @@ func (wrapper FilteringFS) Open(name string) (fs.File, error) {
 		return nil, err
 	}
 
+	if !s.IsDir() && wrapper.excluded(name, false) {
+		closeErr := f.Close()
+		if closeErr != nil {
+			return nil, closeErr
+		}
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
 	if s.IsDir() {
-		// Have an index file or go home!
-		index := filepath.Join(name, "index.html")
-		if _, err := wrapper.fs.Open(index); err != nil {
+		if wrapper.options.RequireIndexHTML && !wrapper.hasIndexHTML(name) {
+			// Have an index file, or a listing if the path allows it,
+			// or go home!
+			if wrapper.dirOpts.ListingEnabled(name) {
+				closeErr := f.Close()
+				if closeErr != nil {
+					return nil, closeErr
+				}
+				return wrapper.listingFile(name)
+			}
+
 			closeErr := f.Close()
 			if closeErr != nil {
 				return nil, closeErr
 			}
 
-			return nil, err
+			return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
 		}
+
+		return wrapper.hideDotEntries(f), nil
 	}
 
 	return f, nil
 }
+
+// hasIndexHTML reports whether dir has an index.html entry.
+func (wrapper FilteringFS) hasIndexHTML(dir string) bool {
+	f, err := wrapper.fs.Open(filepath.Join(dir, "index.html"))
+	if err != nil {
+		return false
+	}
+	f.Close()
+	return true
+}
+
+// listingEligible reports whether name is a directory that Open would
+// serve as a generated listing -- i.e. RequireIndexHTML is set, the
+// path has opted into listings via dirOpts, and there's no index.html
+// to serve instead.
+func (wrapper FilteringFS) listingEligible(name string) bool {
+	if wrapper.excluded(name, true) || !wrapper.options.RequireIndexHTML {
+		return false
+	}
+
+	f, err := wrapper.fs.Open(name)
+	if err != nil {
+		return false
+	}
+	s, statErr := f.Stat()
+	f.Close()
+	if statErr != nil || !s.IsDir() {
+		return false
+	}
+
+	return wrapper.dirOpts.ListingEnabled(name) && !wrapper.hasIndexHTML(name)
+}
+
+// ReadDir satisfies fs.ReadDirFS by delegating to the wrapped fs --
+// which preserves a cross-layer merge if that's a UnionFS -- rather
+// than going through Open and reading a single directory file, so a
+// plain fs.ReadDir(wrapper, name) or fs.Sub(wrapper, name) call sees
+// the same merged, excluded/dot-filtered set that the HTTP listing
+// does.
+func (wrapper FilteringFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if wrapper.excluded(name, true) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+
+	entries, err := fs.ReadDir(wrapper.fs, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return wrapper.filterEntries(name, entries), nil
+}
+
+// filterEntries drops any entry of the directory name whose full path
+// is excluded, so Options.Exclude/Include and HideDotFiles apply to
+// listings the same way they apply to Open.
+func (wrapper FilteringFS) filterEntries(name string, entries []fs.DirEntry) []fs.DirEntry {
+	kept := entries[:0]
+	for _, entry := range entries {
+		if wrapper.excluded(path.Join(name, entry.Name()), entry.IsDir()) {
+			continue
+		}
+		kept = append(kept, entry)
+	}
+	return kept
+}
+
+// hideDotEntries wraps f so that, if it's a directory supporting
+// ReadDir, dot-prefixed entries never show up in its listing -- this
+// is what keeps fs.ReadDir and fs.Sub callers honest even when they
+// never go through Open's own dot-element rejection.
+//
+// This follows the dotFileHidingFile pattern from net/http's
+// dotFileHidingFileSystem example.
+func (wrapper FilteringFS) hideDotEntries(f fs.File) fs.File {
+	if !wrapper.options.HideDotFiles {
+		return f
+	}
+
+	rdf, ok := f.(fs.ReadDirFile)
+	if !ok {
+		return f
+	}
+
+	return dotHidingDir{rdf}
+}
+
+// dotHidingDir wraps a directory fs.File so that its ReadDir never
+// returns dot-prefixed entries.
+type dotHidingDir struct {
+	fs.ReadDirFile
+}
+
+func (d dotHidingDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if n <= 0 {
+		entries, err := d.ReadDirFile.ReadDir(-1)
+		return filterDotEntries(entries), err
+	}
+
+	filtered := make([]fs.DirEntry, 0, n)
+	for len(filtered) < n {
+		entries, err := d.ReadDirFile.ReadDir(n - len(filtered))
+		filtered = append(filtered, filterDotEntries(entries)...)
+		if err != nil {
+			return filtered, err
+		}
+		if len(entries) == 0 {
+			break
+		}
+	}
+
+	return filtered, nil
+}
+
+// filterDotEntries drops any entry whose name begins with a dot.
+func filterDotEntries(entries []fs.DirEntry) []fs.DirEntry {
+	kept := entries[:0]
+	for _, entry := range entries {
+		name := entry.Name()
+		if len(name) > 0 && name[:1] == "." {
+			continue
+		}
+		kept = append(kept, entry)
+	}
+	return kept
+}
+
+// listingFile renders a directory listing for name and returns it as
+// an fs.File masquerading as a regular (non-directory) file, so that
+// http.FileServer serves it as-is instead of trying to generate its
+// own listing.
+func (wrapper FilteringFS) listingFile(name string) (fs.File, error) {
+	body, err := renderListing(wrapper, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &listing{
+		Reader: bytes.NewReader(body),
+		info: listingInfo{
+			name: path.Base(name),
+			size: int64(len(body)),
+		},
+	}, nil
+}
+
+// renderListing builds a minimal HTML directory listing for name, in
+// the spirit of net/http's unexported dirList. fsys is expected to be
+// a FilteringFS (or something that filters the same way), so entries
+// are already excluded/dot-filtered by the time fs.ReadDir returns
+// them here.
+func renderListing(fsys fs.FS, name string) ([]byte, error) {
+	entries, err := fs.ReadDir(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+
+	// Root hrefs at the request directory instead of leaving them
+	// relative: http.FileServer serves this listing as a plain file
+	// (see listingInfo.IsDir), so it canonicalizes away any trailing
+	// slash and a relative href would resolve one level too high.
+	base := cleanFSPath(name)
+	prefix := "/"
+	if base != "" {
+		prefix = "/" + base + "/"
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("<!doctype html>\n<meta charset=\"utf-8\">\n<pre>\n")
+	for _, entry := range entries {
+		entryName := entry.Name()
+		display := entryName
+		href := url.URL{Path: prefix + entryName}
+		if entry.IsDir() {
+			display += "/"
+			href.Path += "/"
+		}
+
+		fmt.Fprintf(&buf, "<a href=\"%s\">%s</a>\n", href.String(), html.EscapeString(display))
+	}
+	buf.WriteString("</pre>\n")
+
+	return buf.Bytes(), nil
+}
+
+// listing is a read-only fs.File wrapping a generated directory
+// listing's bytes.
+type listing struct {
+	*bytes.Reader
+	info listingInfo
+}
+
+func (l *listing) Stat() (fs.FileInfo, error) { return l.info, nil }
+func (l *listing) Close() error               { return nil }
+
+// listingInfo is a minimal fs.FileInfo for a generated listing.
+type listingInfo struct {
+	name string
+	size int64
+}
+
+func (i listingInfo) Name() string       { return i.name }
+func (i listingInfo) Size() int64        { return i.size }
+func (i listingInfo) Mode() fs.FileMode  { return 0o444 }
+func (i listingInfo) ModTime() time.Time { return time.Time{} }
+func (i listingInfo) IsDir() bool        { return false }
+func (i listingInfo) Sys() any           { return nil }
+
+// UnionFS overlays an ordered list of fs.FS backends, so a live
+// directory can be layered over an embed.FS to shadow individual
+// files without a rebuild. UnionFS composes with FilteringFS like any
+// other fs.FS, so exclude and dot-file rules still apply uniformly
+// across every layer. Open resolves a file to whichever single layer
+// hits first; ReadDir instead merges every layer's entries, since a
+// directory listing needs to see the union, not just the top layer.
+type UnionFS struct {
+	layers []fs.FS
+}
+
+// NewUnionFS builds a UnionFS from layers, ordered from highest to
+// lowest priority: the first layer to resolve a path wins.
+func NewUnionFS(layers ...fs.FS) UnionFS {
+	return UnionFS{layers: layers}
+}
+
+func (u UnionFS) Open(name string) (fs.File, error) {
+	var firstErr error
+	for _, layer := range u.layers {
+		f, err := layer.Open(name)
+		if err == nil {
+			return f, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	if firstErr == nil {
+		firstErr = &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return nil, firstErr
+}
+
+// ReadDir merges the directory entries of name across every layer,
+// de-duplicating by name; where more than one layer has an entry of
+// the same name, the earlier layer wins.
+func (u UnionFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	seen := make(map[string]bool)
+	var merged []fs.DirEntry
+	var resolved bool
+	var lastErr error
+
+	for _, layer := range u.layers {
+		entries, err := fs.ReadDir(layer, name)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		resolved = true
+		for _, entry := range entries {
+			if seen[entry.Name()] {
+				continue
+			}
+			seen[entry.Name()] = true
+			merged = append(merged, entry)
+		}
+	}
+
+	if !resolved {
+		return nil, lastErr
+	}
+
+	sort.Slice(merged, func(i, j int) bool {
+		return merged[i].Name() < merged[j].Name()
+	})
+
+	return merged, nil
+}
+
+// Stat satisfies fs.StatFS by opening name and statting the result.
+func (u UnionFS) Stat(name string) (fs.FileInfo, error) {
+	f, err := u.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return f.Stat()
+}
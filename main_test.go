@@ -0,0 +1,280 @@
+package main
+
+import (
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// newTestFS builds an in-memory fs.FS from path -> contents, for
+// tests that need a throwaway tree to wrap with FilteringFS/UnionFS.
+func newTestFS(t *testing.T, files map[string]string) fs.FS {
+	t.Helper()
+
+	fsys := make(fstest.MapFS, len(files))
+	for name, data := range files {
+		fsys[name] = &fstest.MapFile{Data: []byte(data)}
+	}
+	return fsys
+}
+
+// TestServeListingTrailingSlash guards against a regression where a
+// generated listing, which reports IsDir() == false so http.FileServer
+// serves its bytes as-is, tripped FileServer's own file-vs-directory
+// redirect logic: a trailing-slash URL -- exactly what the listing's
+// own hrefs point at -- got 301'd away to the slash-less path instead
+// of rendering.
+func TestServeListingTrailingSlash(t *testing.T) {
+	fsys := newTestFS(t, map[string]string{
+		"assets/a.txt": "a",
+		"assets/b.txt": "b",
+	})
+	wrapper := NewFilteringFS(fsys, Options{RequireIndexHTML: true})
+	wrapper.dirOpts = DirOpts{Listing: map[string]bool{"assets": true}}
+
+	srv := httptest.NewServer(wrappedFileServer(wrapper))
+	defer srv.Close()
+
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	resp, err := client.Get(srv.URL + "/assets/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /assets/ = %d, want %d (got Location %q)", resp.StatusCode, http.StatusOK, resp.Header.Get("Location"))
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(body), "a.txt") || !strings.Contains(string(body), "b.txt") {
+		t.Errorf("listing body missing entries: %s", body)
+	}
+}
+
+// TestServeListingBareDirStillWorks pins the pre-existing, already
+// correct slash-less behaviour so the trailing-slash fix above
+// doesn't regress it.
+func TestServeListingBareDirStillWorks(t *testing.T) {
+	fsys := newTestFS(t, map[string]string{
+		"assets/a.txt": "a",
+	})
+	wrapper := NewFilteringFS(fsys, Options{RequireIndexHTML: true})
+	wrapper.dirOpts = DirOpts{Listing: map[string]bool{"assets": true}}
+
+	srv := httptest.NewServer(wrappedFileServer(wrapper))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/assets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /assets = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+}
+
+// TestFilteringFSExcludedRoot guards against a regression where
+// HideDotFiles treated the FS root itself -- "." -- as a dot-prefixed
+// entry and hid it, 404ing every request including "/".
+func TestFilteringFSExcludedRoot(t *testing.T) {
+	wrapper := NewFilteringFS(newTestFS(t, map[string]string{"index.html": "hi"}), Options{
+		HideDotFiles: true,
+	})
+
+	if wrapper.excluded(".", true) {
+		t.Fatal("excluded(\".\") = true, want false: the FS root must never be hidden by HideDotFiles")
+	}
+
+	if _, err := wrapper.Open("."); err != nil {
+		t.Fatalf("Open(\".\") with HideDotFiles: %v", err)
+	}
+}
+
+// TestFilteringFSExcludedMatchesOptions checks excluded against a mix
+// of dot-prefixed, regex-excluded and ordinary paths.
+func TestFilteringFSExcludedMatchesOptions(t *testing.T) {
+	wrapper := NewFilteringFS(fstest.MapFS{}, Options{
+		HideDotFiles: true,
+		Exclude:      []*regexp.Regexp{regexp.MustCompile(`~$`)},
+	})
+
+	cases := []struct {
+		name  string
+		isDir bool
+		want  bool
+	}{
+		{".", true, false},
+		{"assets", true, false},
+		{".git", true, true},
+		{"assets/.hidden", false, true},
+		{"notes.txt~", false, true},
+		{"notes.txt", false, false},
+	}
+	for _, c := range cases {
+		if got := wrapper.excluded(c.name, c.isDir); got != c.want {
+			t.Errorf("excluded(%q, isDir=%v) = %v, want %v", c.name, c.isDir, got, c.want)
+		}
+	}
+}
+
+// TestFilteringFSIncludeExemptsDirectories guards against a
+// regression where Include, a file-extension allowlist, was also
+// applied to directory paths: since a directory's own name rarely
+// matches an extension pattern, turning on Include excluded every
+// directory -- including the FS root -- and broke serving the whole
+// site.
+func TestFilteringFSIncludeExemptsDirectories(t *testing.T) {
+	fsys := newTestFS(t, map[string]string{
+		"index.html":   "root index",
+		"assets/a.txt": "a",
+		"assets/a.bin": "binary",
+	})
+	wrapper := NewFilteringFS(fsys, Options{
+		RequireIndexHTML: true,
+		Include:          []*regexp.Regexp{regexp.MustCompile(`\.(html|txt)$`)},
+	})
+	wrapper.dirOpts = DirOpts{Listing: map[string]bool{"assets": true}}
+
+	if _, err := wrapper.Open("."); err != nil {
+		t.Fatalf("Open(\".\") with Include set: %v", err)
+	}
+
+	// assets/ has no index.html, so this exercises the generated
+	// listing path -- exactly the case the review reported as 404ing.
+	if _, err := wrapper.Open("assets"); err != nil {
+		t.Fatalf("Open(\"assets\") with Include set: %v", err)
+	}
+
+	if _, err := wrapper.Open("assets/a.txt"); err != nil {
+		t.Errorf("Open(\"assets/a.txt\") matching Include: %v", err)
+	}
+
+	if _, err := wrapper.Open("assets/a.bin"); err == nil {
+		t.Error("Open(\"assets/a.bin\") not matching Include: want error, got nil")
+	}
+}
+
+// TestFilteringFSReadDirAppliesExclude guards against a regression
+// where ReadDir only stripped dot entries and left regex-Excluded
+// paths (e.g. the "~" backup pattern) in a generated listing, even
+// though Open already refused to serve them.
+func TestFilteringFSReadDirAppliesExclude(t *testing.T) {
+	fsys := newTestFS(t, map[string]string{
+		"assets/keep.txt":    "keep",
+		"assets/backup.txt~": "backup",
+	})
+	wrapper := NewFilteringFS(fsys, Options{
+		Exclude: []*regexp.Regexp{regexp.MustCompile(`~$`)},
+	})
+
+	entries, err := wrapper.ReadDir("assets")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, entry := range entries {
+		if entry.Name() == "backup.txt~" {
+			t.Errorf("ReadDir returned excluded entry %q", entry.Name())
+		}
+	}
+}
+
+// TestDotHidingDirReadDirBatches exercises dotHidingDir's n > 0 path,
+// which has to keep asking the wrapped ReadDirFile for more entries
+// as dot-prefixed ones get filtered out of each batch, so a caller
+// asking for n entries at a time still sees every visible entry.
+func TestDotHidingDirReadDirBatches(t *testing.T) {
+	fsys := newTestFS(t, map[string]string{
+		"dir/.hidden":  "",
+		"dir/a.txt":    "",
+		"dir/.hidden2": "",
+		"dir/b.txt":    "",
+	})
+	wrapper := NewFilteringFS(fsys, Options{HideDotFiles: true})
+
+	f, err := wrapper.Open("dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	rdf, ok := f.(fs.ReadDirFile)
+	if !ok {
+		t.Fatal("Open(\"dir\") did not return a fs.ReadDirFile")
+	}
+
+	var names []string
+	for {
+		entries, err := rdf.ReadDir(1)
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	sort.Strings(names)
+	want := []string{"a.txt", "b.txt"}
+	if len(names) != len(want) || names[0] != want[0] || names[1] != want[1] {
+		t.Errorf("ReadDir(1) batches yielded %v, want %v", names, want)
+	}
+}
+
+// TestUnionFSMergesAndPrefersHigherLayer checks that ReadDir merges
+// every layer's entries (deduplicated by name) while Open resolves a
+// shadowed name to the higher-priority layer.
+func TestUnionFSMergesAndPrefersHigherLayer(t *testing.T) {
+	high := newTestFS(t, map[string]string{"dir/a.txt": "high"})
+	low := newTestFS(t, map[string]string{
+		"dir/a.txt": "low",
+		"dir/b.txt": "low",
+	})
+	u := NewUnionFS(high, low)
+
+	entries, err := fs.ReadDir(u, "dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+	want := []string{"a.txt", "b.txt"}
+	if len(names) != len(want) || names[0] != want[0] || names[1] != want[1] {
+		t.Fatalf("ReadDir(\"dir\") names = %v, want %v", names, want)
+	}
+
+	f, err := u.Open("dir/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "high" {
+		t.Errorf("Open(\"dir/a.txt\") = %q, want the higher-priority layer's content %q", data, "high")
+	}
+}